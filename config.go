@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// config is the on-disk shape of the -config file: a list of upstream
+// feeds to fetch and split, each with its own show matchers.
+type config struct {
+	Feeds []feedConfig `yaml:"feeds"`
+}
+
+type feedConfig struct {
+	ID           string          `yaml:"id"`
+	Source       string          `yaml:"source"`
+	Refresh      duration        `yaml:"refresh,omitempty"`
+	ShowMatchers []matcherConfig `yaml:"show_matchers,omitempty"`
+}
+
+type matcherConfig struct {
+	Name        string `yaml:"name,omitempty"`
+	TitleRegex  string `yaml:"title_regex,omitempty"`
+	TitlePrefix string `yaml:"title_prefix,omitempty"`
+	SysName     string `yaml:"sys_name,omitempty"`
+}
+
+// duration wraps time.Duration so it can be written as a plain string
+// (e.g. "5m") in the config file.
+type duration time.Duration
+
+func (d *duration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+const defaultFeedURL = "https://feed.podbean.com/badlandsmedia/feed.xml"
+
+// defaultConfig is used when no -config file is given: a single feed
+// source using the hardcoded Badlands show matchers.
+func defaultConfig() *config {
+	return &config{
+		Feeds: []feedConfig{{
+			ID:     "badlands",
+			Source: defaultFeedURL,
+		}},
+	}
+}
+
+// loadConfig reads the feeds config from path, or returns
+// defaultConfig if path is empty.
+func loadConfig(path string) (*config, error) {
+	if path == "" {
+		return defaultConfig(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+
+	var cfg config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// matchers compiles fc's show matchers, falling back to
+// defaultMatchers when none are configured.
+func (fc feedConfig) matchers() ([]showMatcher, error) {
+	if len(fc.ShowMatchers) == 0 {
+		return defaultMatchers(), nil
+	}
+
+	matchers := make([]showMatcher, 0, len(fc.ShowMatchers))
+	for _, mc := range fc.ShowMatchers {
+		m := showMatcher{name: mc.Name, prefix: mc.TitlePrefix, sysName: mc.SysName}
+		if mc.TitleRegex != "" {
+			re, err := regexp.Compile(mc.TitleRegex)
+			if err != nil {
+				return nil, fmt.Errorf("show matcher %q: invalid title_regex: %w", mc.Name, err)
+			}
+			m.regex = re
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
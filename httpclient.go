@@ -0,0 +1,112 @@
+package main
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// version is the value reported in the User-Agent header; override
+// it at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+var userAgent = "badlandsrss/" + version
+
+// errNotModified signals that the upstream feed hasn't changed since
+// the last fetch (a 304 response); callers should keep using what
+// they already have.
+var errNotModified = errors.New("feed not modified")
+
+// httpStatusError is returned when an upstream fetch comes back with
+// a non-2xx, non-304 status.
+type httpStatusError struct {
+	URL    string
+	Status string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("fetch %s: unexpected status: %s", e.URL, e.Status)
+}
+
+// fetchResult is the outcome of a successful conditional fetch.
+type fetchResult struct {
+	Body         []byte
+	ETag         string
+	LastModified string
+}
+
+// feedClient fetches feeds over HTTP, sending conditional GET headers
+// so an unchanged upstream feed doesn't have to be re-downloaded in
+// full on every poll.
+type feedClient struct {
+	client *http.Client
+}
+
+func newFeedClient() *feedClient {
+	return &feedClient{client: http.DefaultClient}
+}
+
+// Fetch requests url, conditional on prev (the result of the last
+// successful fetch of the same url). It returns errNotModified if the
+// upstream reports the feed is unchanged.
+func (c *feedClient) Fetch(ctx context.Context, url string, prev fetchResult) (fetchResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fetchResult{}, fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	if prev.ETag != "" {
+		req.Header.Set("If-None-Match", prev.ETag)
+	}
+	if prev.LastModified != "" {
+		req.Header.Set("If-Modified-Since", prev.LastModified)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fetchResult{}, fmt.Errorf("fetch: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return fetchResult{}, errNotModified
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fetchResult{}, &httpStatusError{URL: url, Status: resp.Status}
+	}
+
+	body, err := decodeBody(resp)
+	if err != nil {
+		return fetchResult{}, fmt.Errorf("decode body: %w", err)
+	}
+
+	return fetchResult{
+		Body:         body,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, nil
+}
+
+// decodeBody reads resp.Body, transparently decompressing it if
+// Content-Encoding says it's gzip or deflate.
+func decodeBody(resp *http.Response) ([]byte, error) {
+	var r io.Reader = resp.Body
+	switch resp.Header.Get("Content-Encoding") {
+	case "gzip":
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+
+	case "deflate":
+		r = flate.NewReader(resp.Body)
+	}
+	return io.ReadAll(r)
+}
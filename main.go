@@ -4,16 +4,14 @@ package main
 
 import (
 	"bytes"
-	"cmp"
 	"context"
-	"encoding/xml"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
-	"html"
 	"html/template"
 	"io"
-	"iter"
 	"log"
 	"log/slog"
 	"maps"
@@ -30,8 +28,13 @@ import (
 
 func main() {
 	addr := flag.String("addr", ":52390", "address to serve on")
-	feed := flag.String("url", "https://feed.podbean.com/badlandsmedia/feed.xml", "feed to fetch")
-	refresh := flag.Duration("refresh", 5*time.Minute, "feed refresh interval")
+	refresh := flag.Duration("refresh", 5*time.Minute, "default feed refresh interval")
+	configPath := flag.String("config", "", "path to a feeds config file (YAML)")
+	stateDir := flag.String("state-dir", "", "directory to persist per-show items in, so trimmed upstream episodes aren't lost (disabled if empty)")
+	maxItems := flag.Int("max-items", 300, "maximum number of items kept per show")
+	publicURL := flag.String("public-url", "", "public base URL used in the /opml export (derived from the request if empty)")
+	webhookURL := flag.String("webhook-url", "", "URL to POST a notification to for each newly seen episode (disabled if empty)")
+	notifyFormatFlag := flag.String("notify-format", "json", "payload shape to POST to -webhook-url: json or apprise")
 	debug := flag.Bool("debug", false, "enable debugging")
 	flag.Parse()
 
@@ -39,11 +42,35 @@ func main() {
 		slog.SetLogLoggerLevel(slog.LevelDebug)
 	}
 
+	var format notifyFormat
+	switch *notifyFormatFlag {
+	case "json":
+		format = notifyFormatJSON
+	case "apprise":
+		format = notifyFormatApprise
+	default:
+		log.Fatalf("invalid -notify-format %q: want json or apprise", *notifyFormatFlag)
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalln("load config:", err)
+	}
+	sources, err := newFeedSources(cfg, *refresh)
+	if err != nil {
+		log.Fatalln("build feed sources:", err)
+	}
+
 	ctx := context.Background()
 	feeds := &feeds{
-		active: make(map[string]*showFeed),
-		feed:   *feed,
-		log:    slog.Default(),
+		active:       make(map[string]*showFeed),
+		bySource:     make(map[string]map[string]*showFeed),
+		sources:      sources,
+		notifiedKeys: make(map[string]map[string]bool),
+		store:        newStore(*stateDir, *maxItems),
+		publicURL:    *publicURL,
+		notifier:     newNotifier(*webhookURL, format, slog.Default()),
+		log:          slog.Default(),
 	}
 	srv := &http.Server{
 		Addr:        *addr,
@@ -51,7 +78,7 @@ func main() {
 		ReadTimeout: 5 * time.Second,
 	}
 
-	go feeds.Run(ctx, *refresh)
+	go feeds.Run(ctx)
 	go func() {
 		err := srv.ListenAndServe()
 		if err != nil && !errors.Is(err, http.ErrServerClosed) {
@@ -69,74 +96,204 @@ func main() {
 	}
 }
 
+// feedSource is one upstream feed configured to be fetched and split
+// into per-show feeds on its own refresh schedule.
+type feedSource struct {
+	id       string
+	url      string
+	refresh  time.Duration
+	matchers []showMatcher
+
+	client *feedClient
+	last   fetchResult // conditional GET state from the last successful fetch
+}
+
+// newFeedSources compiles every feedConfig in cfg into a feedSource,
+// falling back to defaultRefresh where a feed doesn't set its own.
+func newFeedSources(cfg *config, defaultRefresh time.Duration) ([]*feedSource, error) {
+	sources := make([]*feedSource, 0, len(cfg.Feeds))
+	for _, fc := range cfg.Feeds {
+		matchers, err := fc.matchers()
+		if err != nil {
+			return nil, fmt.Errorf("feed %q: %w", fc.ID, err)
+		}
+
+		refresh := time.Duration(fc.Refresh)
+		if refresh <= 0 {
+			refresh = defaultRefresh
+		}
+
+		sources = append(sources, &feedSource{
+			id:       fc.ID,
+			url:      fc.Source,
+			refresh:  refresh,
+			matchers: matchers,
+			client:   newFeedClient(),
+		})
+	}
+	return sources, nil
+}
+
 type feeds struct {
-	mu     sync.RWMutex // protects active
-	active map[string]*showFeed
-	feed   string
-	log    *slog.Logger
+	mu       sync.RWMutex // protects active and bySource
+	active   map[string]*showFeed
+	bySource map[string]map[string]*showFeed // keyed by feedSource.id
+	sources  []*feedSource
+
+	notifyMu     sync.Mutex
+	notifiedKeys map[string]map[string]bool // sysName -> item keys already notified on; see notifyNewItems
+
+	store     *store
+	publicURL string
+	notifier  *notifier
+	log       *slog.Logger
 }
 
-func (f *feeds) Run(ctx context.Context, every time.Duration) {
-	tick := time.Tick(every)
+func (f *feeds) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, src := range f.sources {
+		wg.Add(1)
+		go func(src *feedSource) {
+			defer wg.Done()
+			f.runSource(ctx, src)
+		}(src)
+	}
+	wg.Wait()
+}
+
+func (f *feeds) runSource(ctx context.Context, src *feedSource) {
+	tick := time.Tick(src.refresh)
 
 	for {
-		err := f.updateFeed(ctx, f.feed)
+		err := f.updateFeed(ctx, src)
 		if err == nil {
 			break
 		}
-		f.log.Error("feed fetch failed", "feed", f.feed, "first", true, "err", err)
+		f.log.Error("feed fetch failed", "source", src.id, "first", true, "err", err)
 		<-tick
 	}
 
 	for range tick {
-		err := f.fetchFeed(ctx)
-		if err != nil {
-			f.log.Error("feed fetch failed", "feed", f.feed, "first", false, "err", err)
+		if err := f.fetchFeed(ctx, src); err != nil {
+			f.log.Error("feed fetch failed", "source", src.id, "first", false, "err", err)
 		}
 	}
 }
 
-func (f *feeds) fetchFeed(ctx context.Context) error {
+func (f *feeds) fetchFeed(ctx context.Context, src *feedSource) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
-	return f.updateFeed(ctx, f.feed)
+	return f.updateFeed(ctx, src)
 }
 
-func (f *feeds) updateFeed(ctx context.Context, feed string) error {
-	f.log.Debug("read feed", "feed", feed)
-	data, err := readFeed(ctx, feed)
+func (f *feeds) updateFeed(ctx context.Context, src *feedSource) error {
+	f.log.Debug("read feed", "source", src.id, "url", src.url)
+	data, notModified, err := src.fetch(ctx)
 	if err != nil {
 		return fmt.Errorf("error reading feed: %w", err)
 	}
-
-	p := &parser{data: data}
-	prelude := p.Prelude()
-	postlude := p.Postlude()
-	showItems := make(map[string][][]byte)
-	for item := range p.Items() {
-		show := p.ShowTitle()
-		showItems[show] = append(showItems[show], item)
+	if notModified {
+		f.log.Debug("feed not modified", "source", src.id)
+		return nil
 	}
-	if err := p.Err(); err != nil {
+
+	parsed, err := parseFeed(data)
+	if err != nil {
 		return fmt.Errorf("error parsing feed: %w", err)
 	}
+	shows := matchShows(parsed, src.matchers)
+
+	sourceFeeds := make(map[string]*showFeed)
+	for show, matched := range shows {
+		stored, err := f.store.Load(matched.sysName)
+		if err != nil {
+			return fmt.Errorf("load state for %q: %w", matched.sysName, err)
+		}
+
+		merged, err := f.store.Merge(matched.sysName, stored, matched.items)
+		if err != nil {
+			return fmt.Errorf("merge state for %q: %w", matched.sysName, err)
+		}
+
+		f.notifyNewItems(show, matched.sysName, src.url, matched.items)
+
+		items := make([]rssItem, len(merged))
+		for i, si := range merged {
+			items[i] = si.Item
+		}
 
-	feeds := make(map[string]*showFeed)
-	for show, items := range showItems {
-		sysName := showSysName(show)
-		feeds[sysName] = newShowFeed(show, sysName, prelude, items, postlude)
-		f.log.Debug("found", "show", show, "sys", sysName)
+		sf, err := newShowFeed(parsed.Channel, show, matched.sysName, items)
+		if err != nil {
+			return fmt.Errorf("error building show feed %q: %w", show, err)
+		}
+		sourceFeeds[matched.sysName] = sf
+		f.log.Debug("found", "source", src.id, "show", show, "sys", matched.sysName, "items", len(items))
 	}
 
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	// TODO: make per-show feeds persistent and also merge in
-	// new and updated shows and episodes just parsed in feed
 
-	f.active = feeds
+	f.bySource[src.id] = sourceFeeds
+	f.active = mergeActive(f.bySource)
 	return nil
 }
 
+// notifyNewItems notifies on items of show not already known for
+// sysName, and records the keys of every item passed in as known.
+// The first call for a given sysName only seeds that known set
+// without notifying, so neither a fresh store (no -state-dir) nor the
+// very first fetch of the process floods the webhook with the entire
+// back catalog. Tracking known keys in memory, independent of
+// f.store, also means a feed running with -webhook-url but no
+// -state-dir still notifies on a new item exactly once instead of on
+// every refresh.
+func (f *feeds) notifyNewItems(show, sysName, feedURL string, items []rssItem) {
+	f.notifyMu.Lock()
+	known, baselined := f.notifiedKeys[sysName]
+	if !baselined {
+		known = make(map[string]bool, len(items))
+		f.notifiedKeys[sysName] = known
+	}
+
+	var fresh []rssItem
+	for _, item := range items {
+		key := itemKey(item)
+		if known[key] {
+			continue
+		}
+		known[key] = true
+		if baselined {
+			fresh = append(fresh, item)
+		}
+	}
+	f.notifyMu.Unlock()
+
+	for _, item := range fresh {
+		f.notifier.Notify(newEpisodeNotification(show, sysName, feedURL, item))
+	}
+}
+
+// mergeActive flattens the per-source show feeds into a single map
+// keyed by sysName, as served over HTTP.
+func mergeActive(bySource map[string]map[string]*showFeed) map[string]*showFeed {
+	active := make(map[string]*showFeed)
+	for _, feeds := range bySource {
+		maps.Copy(active, feeds)
+	}
+	return active
+}
+
+// opmlFeeds lists active's shows for the OPML export, sorted by
+// sysName for a stable order.
+func opmlFeeds(active map[string]*showFeed) []opmlFeed {
+	sysNames := slices.Sorted(maps.Keys(active))
+	feeds := make([]opmlFeed, len(sysNames))
+	for i, sysName := range sysNames {
+		feeds[i] = opmlFeed{Show: active[sysName].Show(), SysName: sysName}
+	}
+	return feeds
+}
+
 func (f *feeds) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	log := f.log.With("method", r.Method, "path", r.URL.Path)
 	defer func() { log.Info("http request") }()
@@ -160,6 +317,19 @@ func (f *feeds) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.URL.Path == "/opml" || r.URL.Path == "/subscriptions.opml" {
+		log = log.With("outcome", "render opml")
+		data, err := renderOPML(opmlFeeds(active), publicBaseURL(r, f.publicURL))
+		if err != nil {
+			log = log.With("err", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write(data)
+		return
+	}
+
 	if len(active) == 0 {
 		log = log.With("outcome", "service unavailable")
 		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
@@ -175,6 +345,13 @@ func (f *feeds) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", feed.ETag())
+	if match := r.Header.Get("If-None-Match"); match != "" && match == feed.ETag() {
+		log = log.With("outcome", "not modified", "show", show)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	log = log.With("outcome", "render show feed", "show", show)
 	w.Header().Set("Content-Type", "text/xml")
 	http.ServeContent(w, r, feed.FileName(), feed.PubDate(), feed.ReadSeeker())
@@ -186,171 +363,145 @@ var indexTmpl = template.Must(template.New("index").Parse(
 <ul>{{range $show := .}}
 	<li><a href="/{{ $show }}.xml">{{ $show }}</a></li>{{end}}
 </ul>
+<p><a href="/opml">Subscribe to all shows (OPML)</a></p>
 </body>
 </html>
 `))
 
-func readFeed(ctx context.Context, feed string) ([]byte, error) {
-	u, err := url.Parse(feed)
+// fetch reads src's feed, returning notModified if the upstream
+// reports (via conditional GET) that it hasn't changed since the
+// last successful fetch.
+func (src *feedSource) fetch(ctx context.Context) (data []byte, notModified bool, err error) {
+	u, err := url.Parse(src.url)
 	if err != nil {
-		return nil, fmt.Errorf("invalid feed: %w", err)
+		return nil, false, fmt.Errorf("invalid feed: %w", err)
 	}
 
-	var rc io.ReadCloser
-	switch u.Scheme {
-	case "http", "https":
-		req := &http.Request{
-			Method: "GET",
-			URL:    u,
-		}
-		req = req.WithContext(ctx)
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return nil, fmt.Errorf("fetch: %w", err)
-		}
-		rc = resp.Body
-
-	case "file":
-		file := strings.TrimPrefix(feed, "file://")
-		f, err := os.Open(file)
-		if err != nil {
-			return nil, fmt.Errorf("open: %w", err)
-		}
-		rc = f
+	if u.Scheme == "file" {
+		data, err := readFile(u)
+		return data, false, err
 	}
 
-	defer rc.Close()
-	return io.ReadAll(rc)
-}
+	result, err := src.client.Fetch(ctx, src.url, src.last)
+	if errors.Is(err, errNotModified) {
+		return nil, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
 
-type parser struct {
-	data []byte
-	off  int
-	err  error
-	item []byte
+	src.last = result
+	return result.Body, false, nil
 }
 
-var (
-	itemBegin  = []byte("<item>")
-	itemEnd    = []byte("</item>")
-	titleBegin = []byte("<title>")
-	titleEnd   = []byte("</title>")
-)
-
-var errCorruptFeed = errors.New("corrupt feed")
-
-func (p *parser) Prelude() []byte {
-	if p.err != nil {
-		return nil
-	}
-	i := bytes.Index(p.data, itemBegin)
-	if i == -1 {
-		p.err = errCorruptFeed
-		return nil
-	}
-	// elide newline at end of prelude, everything
-	// else is expected to start with a newline
-	j := bytes.LastIndexByte(p.data[:i], '>')
-	if j == -1 {
-		p.err = errCorruptFeed
-		return nil
+func readFile(u *url.URL) ([]byte, error) {
+	file := strings.TrimPrefix(u.String(), "file://")
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
 	}
-	return p.data[:j+1]
+	defer f.Close()
+	return io.ReadAll(f)
 }
 
-func (p *parser) Postlude() []byte {
-	if p.err != nil {
-		return nil
-	}
-	i := bytes.LastIndex(p.data, itemEnd)
-	if i == -1 {
-		p.err = errCorruptFeed
-		return nil
-	}
-	return p.data[i+len(itemEnd):]
+// showMatcher decides whether an item title belongs to a show, and
+// what to call that show. It's the compiled form of matcherConfig.
+type showMatcher struct {
+	name    string // fixed show name; empty uses the prefix, or regex group 1
+	prefix  string
+	regex   *regexp.Regexp
+	sysName string // overrides showSysName(show) when set
 }
 
-func (p *parser) Items() iter.Seq[[]byte] {
-	return func(yield func([]byte) bool) {
-		i := bytes.Index(p.data, itemBegin)
-		j := bytes.LastIndexByte(p.data[:i], '>')
-		if i == -1 || j == -1 {
-			// check after both lookups is okay
-			// because feed is likely to be valid
-			p.err = errCorruptFeed
-			return
+func (m showMatcher) match(title string) (show string, ok bool) {
+	switch {
+	case m.prefix != "":
+		if !strings.HasPrefix(title, m.prefix) {
+			return "", false
 		}
+		if m.name != "" {
+			return m.name, true
+		}
+		return m.prefix, true
 
-		p.off = j + 1
-		for {
-			i := bytes.Index(p.data[p.off:], itemEnd)
-			if i == -1 {
-				j := bytes.LastIndex(p.data, itemEnd)
-				if j == -1 || p.off != j+len(itemEnd) {
-					p.err = errCorruptFeed
-				}
-				return
-			}
-
-			end := p.off + i + len(itemEnd)
-			p.item = p.data[p.off:end]
-			if !yield(p.item) {
-				return
-			}
-
-			p.off = end
+	case m.regex != nil:
+		groups := m.regex.FindStringSubmatch(title)
+		if groups == nil {
+			return "", false
 		}
-	}
-}
+		if m.name != "" {
+			return m.name, true
+		}
+		if len(groups) > 1 {
+			return groups[1], true
+		}
+		return "", false
 
-func (p *parser) ShowTitle() string {
-	if p.err != nil {
-		return ""
+	default:
+		return "", false
 	}
+}
 
-	off, end := findByteRange(p.item, titleBegin, titleEnd)
-	if off == -1 || end == -1 {
-		p.err = errCorruptFeed
-		return ""
+// defaultMatchers is the matcher set used when a feed config doesn't
+// declare its own show_matchers: the Badlands shows that used to be
+// hardcoded in showTitle.
+func defaultMatchers() []showMatcher {
+	return []showMatcher{
+		{name: "Altered State", prefix: "Altered State"},
+		{name: "WWG1WGA After Dark", regex: wwg1wgaRegexp},
+		{name: "Y-Chromes", regex: yChromesRegexp},
+		{regex: episodeRegexp},
 	}
+}
 
-	title := string(p.item[off:end])
-	show := showTitle(title)
+var (
+	episodeRegexp  = regexp.MustCompile(`(.*?)(?:,? Ep.? \d+(?: -|:)|:| - Chapter \d+:) .*`)
+	wwg1wgaRegexp  = regexp.MustCompile(`WWG1WGA(?: After Dark Ep. \d+:|: After Dark Ep. \d+ –) .*`)
+	yChromesRegexp = regexp.MustCompile(`Y[- ]Chromes Ep. \d+: .*`)
+)
 
-	// package encoding/xml only escapes text
-	// package html seems close enough to XML
-	return html.UnescapeString(show)
+// matchShowTitle returns the first matcher in matchers that matches
+// title, along with the show name it derives.
+func matchShowTitle(title string, matchers []showMatcher) (show string, m showMatcher, ok bool) {
+	for _, m := range matchers {
+		if show, ok := m.match(title); ok {
+			return show, m, true
+		}
+	}
+	return "", showMatcher{}, false
 }
 
-func (p *parser) Err() error {
-	return p.err
+// matchedShow is the items collected for one show, along with the
+// sysName it should be served as.
+type matchedShow struct {
+	items   []rssItem
+	sysName string
 }
 
-func showTitle(title string) string {
-	if strings.HasPrefix(title, "Altered State") {
-		return "Altered State"
-	}
-	if wwg1wgaRegexp.MatchString(title) {
-		return "WWG1WGA After Dark"
-	}
-	if yChromesRegexp.MatchString(title) {
-		return "Y-Chromes"
-	}
+// matchShows groups feed's items by show, using the first matcher
+// that matches each item's title. Items matching no matcher are
+// dropped.
+func matchShows(feed *rssFeed, matchers []showMatcher) map[string]matchedShow {
+	shows := make(map[string]matchedShow)
+	for _, item := range feed.Channel.Items {
+		show, m, ok := matchShowTitle(item.Title, matchers)
+		if !ok {
+			continue
+		}
 
-	matches := episodeRegexp.FindStringSubmatch(title)
-	if matches != nil {
-		return matches[1]
-	}
+		sysName := m.sysName
+		if sysName == "" {
+			sysName = showSysName(show)
+		}
 
-	return ""
+		matched := shows[show]
+		matched.items = append(matched.items, item)
+		matched.sysName = sysName
+		shows[show] = matched
+	}
+	return shows
 }
 
-var (
-	episodeRegexp  = regexp.MustCompile(`(.*?)(?:,? Ep.? \d+(?: -|:)|:| - Chapter \d+:) .*`)
-	wwg1wgaRegexp  = regexp.MustCompile(`WWG1WGA(?: After Dark Ep. \d+:|: After Dark Ep. \d+ –) .*`)
-	yChromesRegexp = regexp.MustCompile(`Y[- ]Chromes Ep. \d+: .*`)
-)
-
 func showSysName(title string) string {
 	escaped := false
 	escape := func(r rune) rune {
@@ -368,162 +519,76 @@ func showSysName(title string) string {
 }
 
 type showFeed struct {
+	show    string // human show name, e.g. for display in the OPML export
 	sysName string
 	pubDate time.Time
+	etag    string
 	data    []byte
 }
 
-func newShowFeed(show, sysName string, prelude []byte, items [][]byte, postlude []byte) *showFeed {
-	edits := fixShowTitle(prelude, show)
-	if e, ok := markFeedPrivate(prelude); ok {
-		edits = append(edits, e)
+func newShowFeed(channel rssChannel, show, sysName string, items []rssItem) (*showFeed, error) {
+	data, err := marshalShowFeed(channel, show, items)
+	if err != nil {
+		return nil, err
 	}
 
-	prelude = applyEdits(prelude, edits)
 	return &showFeed{
+		show:    show,
 		sysName: sysName,
-		pubDate: pubDateOrNow(prelude),
-		data:    concatFeedData(prelude, items, postlude),
-	}
+		pubDate: newestPubDate(items, channel),
+		etag:    etagFor(data),
+		data:    data,
+	}, nil
 }
 
-func concatFeedData(prelude []byte, items [][]byte, postlude []byte) []byte {
-	size := len(prelude)
-	size += len(postlude)
-	for _, ep := range items {
-		size += len(ep)
-	}
+// etagFor derives a strong ETag from the served bytes, so clients
+// polling us get the same conditional-GET behavior we use against
+// the upstream feed.
+func etagFor(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:12]) + `"`
+}
 
-	buf := make([]byte, 0, size)
-	buf = append(buf, prelude...)
+// newestPubDate is the pubDate of the most recent item, so that
+// conditional GETs on the show feed reflect the newest episode we
+// know about rather than the upstream channel's own pubDate.
+func newestPubDate(items []rssItem, channel rssChannel) time.Time {
+	var newest time.Time
 	for _, item := range items {
-		buf = append(buf, item...)
+		if t := itemPubDate(item); t.After(newest) {
+			newest = t
+		}
+	}
+	if newest.IsZero() {
+		return channelPubDate(channel)
 	}
-	buf = append(buf, postlude...)
-	return buf
+	return newest
 }
 
 func (sf *showFeed) FileName() string {
 	return sf.sysName + ".xml"
 }
 
-func (sf *showFeed) PubDate() time.Time {
-	return sf.pubDate
-}
-
-func (sf *showFeed) ReadSeeker() io.ReadSeeker {
-	return bytes.NewReader(sf.data)
-}
-
-func findByteRange(buf, after, before []byte) (off, end int) {
-	i := bytes.Index(buf, after)
-	j := bytes.Index(buf, before)
-	if i != -1 && j != -1 {
-		off = i + len(after)
-		end = j
-		return off, end
-	}
-	return -1, -1
+func (sf *showFeed) Show() string {
+	return sf.show
 }
 
-type edit struct {
-	off  int
-	end  int
-	text string
+func (sf *showFeed) PubDate() time.Time {
+	return sf.pubDate
 }
 
-func applyEdits(buf []byte, edits []edit) []byte {
-	if len(edits) == 0 {
-		return buf
-	}
-
-	slices.SortFunc(edits, func(l, r edit) int {
-		return cmp.Compare(l.off, r.off)
-	})
-
-	// conservatively add a bit extra room
-	size := len(buf)
-	for _, e := range edits {
-		size += len(e.text)
-	}
-
-	newbuf := make([]byte, 0, size)
-	end := 0
-	for _, e := range edits {
-		newbuf = append(newbuf, buf[end:e.off]...)
-		newbuf = append(newbuf, e.text...)
-		end = e.end
-	}
-	newbuf = append(newbuf, buf[end:]...)
-	return newbuf
+func (sf *showFeed) ETag() string {
+	return sf.etag
 }
 
-var (
-	imageBegin      = []byte("<image>")
-	imageEnd        = []byte("</image>")
-	itunesNameBegin = []byte("<itunes:name>")
-	itunesNameEnd   = []byte("</itunes:name>")
-)
-
-func fixShowTitle(prelude []byte, name string) (edits []edit) {
-	var nameBuf bytes.Buffer
-	xml.Escape(&nameBuf, []byte(name))
-	name = nameBuf.String()
-
-	// <title> not in <image>
-	ioff, iend := findByteRange(prelude, imageBegin, imageEnd)
-	if ioff != -1 && iend != -1 {
-		off, end := findByteRange(prelude, titleBegin, titleEnd)
-		// make sure <title> is not inside <image>
-		if off < ioff && end < ioff || off > iend && end > iend {
-			edits = append(edits, edit{
-				off:  off,
-				end:  end,
-				text: name,
-			})
-		}
-	}
-
-	// <itunes:name>
-	off, end := findByteRange(prelude, itunesNameBegin, itunesNameEnd)
-	if off != -1 && end != -1 {
-		edits = append(edits, edit{
-			off:  off,
-			end:  end,
-			text: name,
-		})
-	}
-
-	return edits
-}
-
-var (
-	itunesBlockBegin = []byte("<itunes:block>")
-	itunesBlockEnd   = []byte("</itunes:block>")
-)
-
-func markFeedPrivate(prelude []byte) (e edit, ok bool) {
-	off, end := findByteRange(prelude, itunesBlockBegin, itunesBlockEnd)
-	if off != -1 && end != -1 {
-		e = edit{off: off, end: end, text: "Yes"}
-		ok = true
-	}
-	return e, ok
+func (sf *showFeed) ReadSeeker() io.ReadSeeker {
+	return bytes.NewReader(sf.data)
 }
 
-var (
-	pubDateBegin = []byte("<pubDate>")
-	pubDateEnd   = []byte("</pubDate>")
-)
-
-func pubDateOrNow(prelude []byte) time.Time {
-	i, j := findByteRange(prelude, pubDateBegin, pubDateEnd)
-
-	pubDate := prelude[i:j]
-	t, err := time.Parse(time.RFC1123Z, string(pubDate))
+func channelPubDate(channel rssChannel) time.Time {
+	t, err := time.Parse(time.RFC1123Z, channel.PubDate)
 	if err != nil {
-		t = time.Now()
+		return time.Now()
 	}
-
 	return t
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// opmlDocument is an OPML 2.0 document listing our per-show feeds as
+// subscribable outlines, so a reader can import every show in one go.
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    opmlHead `xml:"head"`
+	Body    opmlBody `xml:"body"`
+}
+
+type opmlHead struct {
+	Title string `xml:"title"`
+}
+
+type opmlBody struct {
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+type opmlOutline struct {
+	Text   string `xml:"text,attr"`
+	Type   string `xml:"type,attr"`
+	XMLURL string `xml:"xmlUrl,attr"`
+}
+
+// opmlFeed is one subscribable feed to list in an OPML export: the
+// human show name to display, and the sysName its feed is served
+// under.
+type opmlFeed struct {
+	Show    string
+	SysName string
+}
+
+// renderOPML builds an OPML document listing each feed as an outline
+// rooted at baseURL.
+func renderOPML(feeds []opmlFeed, baseURL string) ([]byte, error) {
+	doc := opmlDocument{
+		Version: "2.0",
+		Head:    opmlHead{Title: "Badlands Media shows"},
+	}
+	for _, feed := range feeds {
+		doc.Body.Outlines = append(doc.Body.Outlines, opmlOutline{
+			Text:   feed.Show,
+			Type:   "rss",
+			XMLURL: fmt.Sprintf("%s/%s.xml", baseURL, feed.SysName),
+		})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "    ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("encode opml: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// publicBaseURL is the base URL to use for outline xmlUrls: the
+// -public-url flag if configured, otherwise derived from the
+// request's Host and scheme.
+func publicBaseURL(r *http.Request, configured string) string {
+	if configured != "" {
+		return strings.TrimSuffix(configured, "/")
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// rssFeed models the subset of an RSS 2.0 + iTunes/podcast-namespace
+// document that we need to read from an upstream feed and
+// re-serialize per show.
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// encoding/xml lets a field tagged without a namespace match an element
+// of the same local name in any namespace, and the first matching field
+// wins, so in rssChannel and rssItem the namespaced fields are declared
+// ahead of their un-namespaced namesakes (atom:link before link,
+// itunes:image before image, ...).
+type rssChannel struct {
+	AtomLink       *rssAtomLink    `xml:"http://www.w3.org/2005/Atom link,omitempty"`
+	ItunesCategory []rssItunesCat  `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd category,omitempty"`
+	ItunesImage    *rssItunesImage `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image,omitempty"`
+	Title          string          `xml:"title"`
+	Link           string          `xml:"link"`
+	Description    string          `xml:"description"`
+	PubDate        string          `xml:"pubDate,omitempty"`
+	Generator      string          `xml:"generator,omitempty"`
+	Language       string          `xml:"language,omitempty"`
+	Copyright      string          `xml:"copyright,omitempty"`
+	Category       string          `xml:"category,omitempty"`
+	TTL            string          `xml:"ttl,omitempty"`
+	Image          *rssImage       `xml:"image,omitempty"`
+	ItunesType     string          `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd type,omitempty"`
+	ItunesSummary  string          `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd summary,omitempty"`
+	ItunesAuthor   string          `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd author,omitempty"`
+	ItunesOwner    *rssItunesOwner `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd owner,omitempty"`
+	ItunesBlock    string          `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd block,omitempty"`
+	ItunesExplicit string          `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd explicit,omitempty"`
+	Items          []rssItem       `xml:"item"`
+}
+
+type rssAtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type rssImage struct {
+	URL    string `xml:"url"`
+	Title  string `xml:"title"`
+	Link   string `xml:"link"`
+	Width  string `xml:"width,omitempty"`
+	Height string `xml:"height,omitempty"`
+}
+
+type rssItunesCat struct {
+	Text string         `xml:"text,attr"`
+	Sub  []rssItunesCat `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd category,omitempty"`
+}
+
+type rssItunesOwner struct {
+	Name  string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd name"`
+	Email string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd email,omitempty"`
+}
+
+type rssItunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+// rssItem is a single <item> in the upstream feed, with the fields
+// we act on plus ,any passthrough for everything else so unknown
+// elements (podcast:*, content:encoded, ...) survive re-serialization.
+type rssItem struct {
+	ItunesTitle string        `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd title,omitempty"`
+	Title       string        `xml:"title"`
+	Description string        `xml:"description,omitempty"`
+	Link        string        `xml:"link,omitempty"`
+	GUID        *rssGUID      `xml:"guid,omitempty"`
+	PubDate     string        `xml:"pubDate,omitempty"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+	Other       []rssAny      `xml:",any"`
+}
+
+// rssGUID is an RSS <guid>: opaque text plus the isPermaLink
+// attribute, which the spec defaults to true when absent. Modeling
+// it as a bare string would silently turn every opaque guid (the
+// common case) into a claimed permalink once re-served.
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink string `xml:"isPermaLink,attr,omitempty"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length string `xml:"length,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+}
+
+// rssAny captures an element we don't model explicitly so it can be
+// re-emitted byte-for-byte.
+type rssAny struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Inner   string     `xml:",innerxml"`
+}
+
+// passthroughPrefixes maps the namespace URIs a passthrough element's
+// XMLName.Space is resolved to onto the prefix it's conventionally
+// declared under, so outItems re-encode it the way it decoded
+// (<itunes:duration>, <podcast:transcript>, ...) instead of
+// re-declaring the namespace as default on every element.
+var passthroughPrefixes = map[string]string{
+	"http://www.itunes.com/dtds/podcast-1.0.dtd": "itunes",
+	"http://www.w3.org/2005/Atom":                "atom",
+	"http://purl.org/rss/1.0/modules/content/":   "content",
+	"https://podcastindex.org/namespace/1.0":     "podcast",
+}
+
+// namespaceAttrs declares every prefix passthroughPrefixes may rewrite
+// an element into, in a fixed order (iterating passthroughPrefixes
+// directly would make the served bytes, and so their ETag, flap
+// between otherwise-identical fetches).
+var namespaceAttrs = []xml.Attr{
+	{Name: xml.Name{Local: "xmlns:itunes"}, Value: "http://www.itunes.com/dtds/podcast-1.0.dtd"},
+	{Name: xml.Name{Local: "xmlns:atom"}, Value: "http://www.w3.org/2005/Atom"},
+	{Name: xml.Name{Local: "xmlns:content"}, Value: "http://purl.org/rss/1.0/modules/content/"},
+	{Name: xml.Name{Local: "xmlns:podcast"}, Value: "https://podcastindex.org/namespace/1.0"},
+}
+
+// outAnys converts decoded passthrough elements (tagged with a
+// namespace URI for decoding) into their literal-prefix output form.
+func outAnys(anys []rssAny) []rssAny {
+	if anys == nil {
+		return nil
+	}
+	out := make([]rssAny, len(anys))
+	for i, a := range anys {
+		if prefix, ok := passthroughPrefixes[a.XMLName.Space]; ok {
+			a.XMLName = xml.Name{Local: prefix + ":" + a.XMLName.Local}
+		}
+		out[i] = a
+	}
+	return out
+}
+
+// parseFeed decodes an upstream RSS document, auto-detecting its
+// character encoding (declared in the XML prolog or the HTTP
+// Content-Type) instead of assuming UTF-8.
+func parseFeed(data []byte) (*rssFeed, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.CharsetReader = charset.NewReaderLabel
+
+	var feed rssFeed
+	if err := d.Decode(&feed); err != nil {
+		return nil, fmt.Errorf("decode feed: %w", err)
+	}
+	return &feed, nil
+}
+
+// itemPubDate parses an RSS <pubDate>, falling back to the zero time
+// if it's missing or malformed.
+func itemPubDate(item rssItem) time.Time {
+	t, err := time.Parse(time.RFC1123Z, item.PubDate)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// outRSS, outChannel, outItunesCat, outItunesOwner and outItem mirror
+// their rss* counterparts, but spell the itunes:/atom:-prefixed
+// elements out literally instead of tagging them with the itunes/atom
+// namespace URI. encoding/xml has no way to bind a field's namespace
+// to the xmlns:itunes/xmlns:atom prefixes declared on <rss> below —
+// given a namespaced tag it re-declares that namespace as the default
+// namespace on every element instead, which other feed readers don't
+// expect. Writing the prefix into the element name keeps it literal.
+type outRSS struct {
+	XMLName xml.Name   `xml:"rss"`
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Channel outChannel `xml:"channel"`
+}
+
+type outChannel struct {
+	Title          string          `xml:"title"`
+	Link           string          `xml:"link"`
+	Description    string          `xml:"description"`
+	PubDate        string          `xml:"pubDate,omitempty"`
+	Generator      string          `xml:"generator,omitempty"`
+	Language       string          `xml:"language,omitempty"`
+	Copyright      string          `xml:"copyright,omitempty"`
+	Category       string          `xml:"category,omitempty"`
+	TTL            string          `xml:"ttl,omitempty"`
+	AtomLink       *rssAtomLink    `xml:"atom:link,omitempty"`
+	Image          *rssImage       `xml:"image,omitempty"`
+	ItunesType     string          `xml:"itunes:type,omitempty"`
+	ItunesSummary  string          `xml:"itunes:summary,omitempty"`
+	ItunesAuthor   string          `xml:"itunes:author,omitempty"`
+	ItunesCategory []outItunesCat  `xml:"itunes:category,omitempty"`
+	ItunesOwner    *outItunesOwner `xml:"itunes:owner,omitempty"`
+	ItunesBlock    string          `xml:"itunes:block,omitempty"`
+	ItunesExplicit string          `xml:"itunes:explicit,omitempty"`
+	ItunesImage    *rssItunesImage `xml:"itunes:image,omitempty"`
+	Items          []outItem       `xml:"item"`
+}
+
+type outItunesCat struct {
+	Text string         `xml:"text,attr"`
+	Sub  []outItunesCat `xml:"itunes:category,omitempty"`
+}
+
+type outItunesOwner struct {
+	Name  string `xml:"itunes:name"`
+	Email string `xml:"itunes:email,omitempty"`
+}
+
+type outItem struct {
+	Title       string        `xml:"title"`
+	Description string        `xml:"description,omitempty"`
+	Link        string        `xml:"link,omitempty"`
+	GUID        *rssGUID      `xml:"guid,omitempty"`
+	PubDate     string        `xml:"pubDate,omitempty"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+	ItunesTitle string        `xml:"itunes:title,omitempty"`
+	Other       []rssAny      `xml:",any"`
+}
+
+// marshalShowFeed builds a full RSS document for a single show: the
+// upstream channel metadata, with the title/iTunes name overridden to
+// the show name and the feed marked private, followed by that show's
+// items.
+func marshalShowFeed(channel rssChannel, show string, items []rssItem) ([]byte, error) {
+	channel.Title = show
+	if channel.ItunesOwner != nil {
+		owner := *channel.ItunesOwner
+		owner.Name = show
+		channel.ItunesOwner = &owner
+	}
+	if channel.Image != nil {
+		image := *channel.Image
+		image.Title = show
+		channel.Image = &image
+	}
+	channel.ItunesBlock = "Yes"
+	channel.Items = items
+
+	out := outChannel{
+		Title:          channel.Title,
+		Link:           channel.Link,
+		Description:    channel.Description,
+		PubDate:        channel.PubDate,
+		Generator:      channel.Generator,
+		Language:       channel.Language,
+		Copyright:      channel.Copyright,
+		Category:       channel.Category,
+		TTL:            channel.TTL,
+		AtomLink:       channel.AtomLink,
+		Image:          channel.Image,
+		ItunesType:     channel.ItunesType,
+		ItunesSummary:  channel.ItunesSummary,
+		ItunesAuthor:   channel.ItunesAuthor,
+		ItunesCategory: outItunesCats(channel.ItunesCategory),
+		ItunesBlock:    channel.ItunesBlock,
+		ItunesExplicit: channel.ItunesExplicit,
+		ItunesImage:    channel.ItunesImage,
+	}
+	if channel.ItunesOwner != nil {
+		out.ItunesOwner = &outItunesOwner{
+			Name:  channel.ItunesOwner.Name,
+			Email: channel.ItunesOwner.Email,
+		}
+	}
+	for _, item := range channel.Items {
+		out.Items = append(out.Items, outItem{
+			Title:       item.Title,
+			Description: item.Description,
+			Link:        item.Link,
+			GUID:        item.GUID,
+			PubDate:     item.PubDate,
+			Enclosure:   item.Enclosure,
+			ItunesTitle: item.ItunesTitle,
+			Other:       outAnys(item.Other),
+		})
+	}
+
+	feed := outRSS{
+		XMLName: xml.Name{Local: "rss"},
+		Attrs: append([]xml.Attr{
+			{Name: xml.Name{Local: "version"}, Value: "2.0"},
+		}, namespaceAttrs...),
+		Channel: out,
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "    ")
+	if err := enc.Encode(feed); err != nil {
+		return nil, fmt.Errorf("encode feed: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// outItunesCats converts decoded iTunes categories (tagged with the
+// itunes namespace URI for decoding) into their literal-prefix output
+// form, recursing into sub-categories.
+func outItunesCats(cats []rssItunesCat) []outItunesCat {
+	if cats == nil {
+		return nil
+	}
+	out := make([]outItunesCat, len(cats))
+	for i, c := range cats {
+		out[i] = outItunesCat{Text: c.Text, Sub: outItunesCats(c.Sub)}
+	}
+	return out
+}
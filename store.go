@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// store persists each show's merged item list to disk, keyed by
+// sysName, so episodes trimmed from the upstream feed aren't lost
+// from our per-show feeds across refreshes.
+type store struct {
+	dir      string
+	maxItems int
+}
+
+func newStore(dir string, maxItems int) *store {
+	return &store{dir: dir, maxItems: maxItems}
+}
+
+// storedItem is the on-disk representation of one item: the decoded
+// RSS item plus the key used to detect duplicates across fetches.
+type storedItem struct {
+	Key     string    `json:"key"`
+	PubDate time.Time `json:"pub_date"`
+	Item    rssItem   `json:"item"`
+}
+
+// itemKey identifies an item across fetches: its GUID, falling back
+// to a hash of the enclosure URL, and finally the title, for feeds
+// that omit both.
+func itemKey(item rssItem) string {
+	if item.GUID != nil && item.GUID.Value != "" {
+		return item.GUID.Value
+	}
+	if item.Enclosure != nil && item.Enclosure.URL != "" {
+		sum := sha256.Sum256([]byte(item.Enclosure.URL))
+		return hex.EncodeToString(sum[:])
+	}
+	return item.Title
+}
+
+func (s *store) path(sysName string) string {
+	return filepath.Join(s.dir, sysName+".json")
+}
+
+// Load reads the previously persisted items for sysName, returning
+// nil if the store has no state dir configured or nothing is stored
+// yet.
+func (s *store) Load(sysName string) ([]storedItem, error) {
+	if s.dir == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(s.path(sysName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read state: %w", err)
+	}
+
+	var items []storedItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("decode state: %w", err)
+	}
+	return items, nil
+}
+
+// Merge folds fresh into stored, keyed by itemKey so new and updated
+// items replace older ones with the same key, sorts the result by
+// pubDate descending, caps it at s.maxItems, persists it and returns
+// it.
+func (s *store) Merge(sysName string, stored []storedItem, fresh []rssItem) ([]storedItem, error) {
+	byKey := make(map[string]storedItem, len(stored)+len(fresh))
+	for _, si := range stored {
+		byKey[si.Key] = si
+	}
+	for _, item := range fresh {
+		key := itemKey(item)
+		byKey[key] = storedItem{Key: key, PubDate: itemPubDate(item), Item: item}
+	}
+
+	merged := make([]storedItem, 0, len(byKey))
+	for _, si := range byKey {
+		merged = append(merged, si)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].PubDate.After(merged[j].PubDate)
+	})
+	if s.maxItems > 0 && len(merged) > s.maxItems {
+		merged = merged[:s.maxItems]
+	}
+
+	if err := s.save(sysName, merged); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+func (s *store) save(sysName string, items []storedItem) error {
+	if s.dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+
+	data, err := json.Marshal(items)
+	if err != nil {
+		return fmt.Errorf("encode state: %w", err)
+	}
+
+	// write to a temp file first so a crash mid-write can't corrupt
+	// the existing state for sysName
+	tmp := s.path(sysName) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write state: %w", err)
+	}
+	return os.Rename(tmp, s.path(sysName))
+}
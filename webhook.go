@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// notifyFormat selects the JSON shape POSTed to -webhook-url.
+type notifyFormat string
+
+const (
+	notifyFormatJSON    notifyFormat = "json"
+	notifyFormatApprise notifyFormat = "apprise"
+)
+
+// episodeNotification describes one newly seen episode, reported to
+// the configured webhook after it's been merged into the store.
+type episodeNotification struct {
+	Show         string    `json:"show"`
+	SysName      string    `json:"sys_name"`
+	Title        string    `json:"title"`
+	GUID         string    `json:"guid"`
+	PubDate      time.Time `json:"pub_date"`
+	EnclosureURL string    `json:"enclosure_url"`
+	FeedURL      string    `json:"feed_url"`
+}
+
+// newEpisodeNotification builds the notification payload for a
+// newly seen item of show.
+func newEpisodeNotification(show, sysName, feedURL string, item rssItem) episodeNotification {
+	en := episodeNotification{
+		Show:    show,
+		SysName: sysName,
+		Title:   item.Title,
+		PubDate: itemPubDate(item),
+		FeedURL: feedURL,
+	}
+	if item.GUID != nil {
+		en.GUID = item.GUID.Value
+	}
+	if item.Enclosure != nil {
+		en.EnclosureURL = item.Enclosure.URL
+	}
+	return en
+}
+
+// appriseNotification is the {title, body, type} shape an Apprise API
+// server expects.
+type appriseNotification struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	Type  string `json:"type"`
+}
+
+const (
+	notifierWorkers      = 4
+	notifierQueueSize    = 256
+	notifierMaxAttempts  = 3
+	notifierRetryBackoff = time.Second
+)
+
+// notifier posts episodeNotifications to a webhook URL through a
+// bounded pool of workers, so a slow or unreachable webhook can't
+// stall the feed refresh loop that feeds it.
+type notifier struct {
+	url    string
+	format notifyFormat
+	client *http.Client
+	log    *slog.Logger
+	work   chan episodeNotification
+}
+
+func newNotifier(url string, format notifyFormat, log *slog.Logger) *notifier {
+	n := &notifier{
+		url:    url,
+		format: format,
+		client: &http.Client{Timeout: 10 * time.Second},
+		log:    log,
+		work:   make(chan episodeNotification, notifierQueueSize),
+	}
+	if url != "" {
+		for i := 0; i < notifierWorkers; i++ {
+			go n.run()
+		}
+	}
+	return n
+}
+
+// Notify enqueues en for delivery. It never blocks: if the queue is
+// full the notification is dropped and logged.
+func (n *notifier) Notify(en episodeNotification) {
+	if n.url == "" {
+		return
+	}
+	select {
+	case n.work <- en:
+	default:
+		n.log.Warn("webhook queue full, dropping notification", "show", en.Show, "guid", en.GUID)
+	}
+}
+
+func (n *notifier) run() {
+	for en := range n.work {
+		if err := n.deliver(en); err != nil {
+			n.log.Error("webhook delivery failed", "show", en.Show, "guid", en.GUID, "err", err)
+		}
+	}
+}
+
+func (n *notifier) deliver(en episodeNotification) error {
+	body, err := n.encode(en)
+	if err != nil {
+		return fmt.Errorf("encode notification: %w", err)
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= notifierMaxAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * notifierRetryBackoff)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		lastErr = n.post(ctx, body)
+		cancel()
+		if lastErr == nil {
+			return nil
+		}
+	}
+	return lastErr
+}
+
+func (n *notifier) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &httpStatusError{URL: n.url, Status: resp.Status}
+	}
+	return nil
+}
+
+func (n *notifier) encode(en episodeNotification) ([]byte, error) {
+	if n.format == notifyFormatApprise {
+		return json.Marshal(appriseNotification{
+			Title: fmt.Sprintf("New episode: %s", en.Show),
+			Body:  en.Title,
+			Type:  "info",
+		})
+	}
+	return json.Marshal(en)
+}
@@ -1,8 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"slices"
 	"testing"
+	"time"
 )
 
 func TestShowTitle(t *testing.T) {
@@ -23,9 +34,10 @@ func TestShowTitle(t *testing.T) {
 		{"Altered State S3 Ep. 22: Tariff Day, Tech Troubles &amp; Nazi Secrets in Argentina", "Altered State"},
 		{"Altered State Season 3, Ep. 21: Pennsylvania's Special Election Shocker, Executive Orders, and Election Fraud Fallout", "Altered State"},
 	} {
-		got := showTitle(c.in)
+		matchers := defaultMatchers()
+		got, _, _ := matchShowTitle(c.in, matchers)
 		if got != c.want {
-			t.Errorf("showTitle(%q) = %q, want: %q", c.in, got, c.want)
+			t.Errorf("matchShowTitle(%q) = %q, want: %q", c.in, got, c.want)
 		}
 	}
 }
@@ -47,61 +59,367 @@ func TestShowSysName(t *testing.T) {
 	}
 }
 
-const prelude = `<?xml version="1.0" encoding="UTF-8"?><!-- generator="podbean/5.5" -->
-<rss version="2.0"
-     xmlns:content="http://purl.org/rss/1.0/modules/content/"
-     xmlns:wfw="http://wellformedweb.org/CommentAPI/"
-     xmlns:dc="http://purl.org/dc/elements/1.1/"
-     xmlns:atom="http://www.w3.org/2005/Atom"
-     xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd"
-     xmlns:googleplay="http://www.google.com/schemas/play-podcasts/1.0"
-     xmlns:spotify="http://www.spotify.com/ns/rss"
-     xmlns:podcast="https://podcastindex.org/namespace/1.0"
-    xmlns:media="http://search.yahoo.com/mrss/">
-
+const feedXML = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd" xmlns:podcast="https://podcastindex.org/namespace/1.0">
 <channel>
     <title>Badlands Media</title>
-    <atom:link href="https://feed.podbean.com/badlandsmedia/feed.xml" rel="self" type="application/rss+xml"/>
     <link>https://badlandsmedia.podbean.com</link>
-    <description>Badlands Media features the work of a dedicated group of Patriot citizen journalists who are changing the media landscape in America. Badlands Media shows are originally broadcast LIVE on Rumble.com/BadlandsMedia. Join us live on Rumble to interact with our community and the hosts in the chat.</description>
+    <description>Badlands Media shows.</description>
     <pubDate>Wed, 02 Apr 2025 01:31:02 -0400</pubDate>
-    <generator>https://podbean.com/?v=5.5</generator>
-    <language>en</language>
-    <spotify:countryOfOrigin>us</spotify:countryOfOrigin>
-    <copyright>Copyright 2024 All rights reserved.</copyright>
-    <category>News:News Commentary</category>
-    <ttl>1440</ttl>
-    <itunes:type>episodic</itunes:type>
-          <itunes:summary>Badlands Media features the work of a dedicated group of Patriot citizen journalists who are changing the media landscape in America. Badlands Media shows are originally broadcast LIVE on Rumble.com/BadlandsMedia.</itunes:summary>
-        <itunes:author>Badlands Media</itunes:author>
-	<itunes:category text="News">
-		<itunes:category text="News Commentary" />
-		<itunes:category text="Politics" />
-	</itunes:category>
     <itunes:owner>
         <itunes:name>Badlands Media</itunes:name>
-            </itunes:owner>
-    	<itunes:block>No</itunes:block>
-	<itunes:explicit>false</itunes:explicit>
-    <itunes:image href="https://pbcdn1.podbean.com/imglogo/image-logo/15577742/1_2tf2af.jpg" />
+    </itunes:owner>
+    <itunes:block>No</itunes:block>
     <image>
         <url>https://pbcdn1.podbean.com/imglogo/image-logo/15577742/1_2tf2af.jpg</url>
         <title>Badlands Media</title>
         <link>https://badlandsmedia.podbean.com</link>
-        <width>144</width>
-        <height>144</height>
-    </image>`
+    </image>
+    <item>
+        <title>Bad Friends Ep. 1: In the Beginning Was the Word... and a Lot of Chaos</title>
+        <guid isPermaLink="false">bad-friends-1</guid>
+        <pubDate>Wed, 02 Apr 2025 01:31:02 -0400</pubDate>
+        <itunes:duration>01:02:03</itunes:duration>
+        <podcast:transcript url="https://badlandsmedia.podbean.com/ep1.srt" type="application/srt"></podcast:transcript>
+    </item>
+</channel>
+</rss>
+`
+
+func TestMarshalShowFeed(t *testing.T) {
+	feed, err := parseFeed([]byte(feedXML))
+	if err != nil {
+		t.Fatalf("parseFeed: %v", err)
+	}
+
+	shows := matchShows(feed, defaultMatchers())
+	matched, ok := shows["Bad Friends"]
+	if !ok {
+		t.Fatalf("show %q not found in %v", "Bad Friends", shows)
+	}
+
+	data, err := marshalShowFeed(feed.Channel, "Bad Friends", matched.items)
+	if err != nil {
+		t.Fatalf("marshalShowFeed: %v", err)
+	}
+
+	got, err := parseFeed(data)
+	if err != nil {
+		t.Fatalf("parseFeed(marshaled show feed): %v\n%s", err, data)
+	}
+
+	if got.Channel.Title != "Bad Friends" {
+		t.Errorf("channel title = %q, want %q", got.Channel.Title, "Bad Friends")
+	}
+	if got.Channel.ItunesOwner == nil || got.Channel.ItunesOwner.Name != "Bad Friends" {
+		t.Errorf("itunes:name = %+v, want %q", got.Channel.ItunesOwner, "Bad Friends")
+	}
+	if got.Channel.ItunesBlock != "Yes" {
+		t.Errorf("itunes:block = %q, want %q", got.Channel.ItunesBlock, "Yes")
+	}
+	if len(got.Channel.Items) != 1 {
+		t.Fatalf("items = %+v, want one item", got.Channel.Items)
+	}
+	item := got.Channel.Items[0]
+	if item.GUID == nil || item.GUID.Value != "bad-friends-1" || item.GUID.IsPermaLink != "false" {
+		t.Errorf("guid = %+v, want value %q with isPermaLink=false", item.GUID, "bad-friends-1")
+	}
+
+	// iTunes elements must use the itunes: prefix declared on <rss>,
+	// not re-declare the itunes namespace as the default namespace on
+	// every element. The same goes for passthrough elements from other
+	// namespaces, like podcast:transcript.
+	for _, want := range []string{"<itunes:owner>", "<itunes:name>", "<itunes:block>", "<itunes:duration>", "<podcast:transcript"} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("marshaled feed missing %s, got:\n%s", want, data)
+		}
+	}
+	if bytes.Contains(data, []byte(`xmlns="http://www.itunes.com/dtds/podcast-1.0.dtd"`)) {
+		t.Errorf("marshaled feed re-declares itunes namespace as default instead of using the itunes: prefix:\n%s", data)
+	}
+	if bytes.Contains(data, []byte(`xmlns="https://podcastindex.org/namespace/1.0"`)) {
+		t.Errorf("marshaled feed re-declares podcast-index namespace as default instead of using the podcast: prefix:\n%s", data)
+	}
+}
+
+func TestFeedConfigMatchers(t *testing.T) {
+	fc := feedConfig{
+		ID: "example",
+		ShowMatchers: []matcherConfig{
+			{Name: "Bad Friends", TitlePrefix: "Bad Friends"},
+			{TitleRegex: `(.*?) Ep\. \d+: .*`},
+		},
+	}
+
+	matchers, err := fc.matchers()
+	if err != nil {
+		t.Fatalf("matchers: %v", err)
+	}
+
+	show, _, ok := matchShowTitle("Bad Friends Ep. 1: Pilot", matchers)
+	if !ok || show != "Bad Friends" {
+		t.Errorf("matchShowTitle(title prefix) = %q, %v, want %q, true", show, ok, "Bad Friends")
+	}
 
-func TestReplaceShowTitle(t *testing.T) {
-	const name = "Show Title"
+	show, _, ok = matchShowTitle("Some Show Ep. 2: Return", matchers)
+	if !ok || show != "Some Show" {
+		t.Errorf("matchShowTitle(title regex) = %q, %v, want %q, true", show, ok, "Some Show")
+	}
+}
+
+func TestFeedConfigMatchersInvalidRegex(t *testing.T) {
+	fc := feedConfig{ShowMatchers: []matcherConfig{{TitleRegex: "("}}}
+	if _, err := fc.matchers(); err == nil {
+		t.Error("matchers() with invalid title_regex: want error, got nil")
+	}
+}
+
+func TestStoreMerge(t *testing.T) {
+	s := newStore(t.TempDir(), 2)
+
+	old := []rssItem{
+		{GUID: &rssGUID{Value: "a"}, PubDate: "Wed, 02 Apr 2025 01:00:00 -0400"},
+		{GUID: &rssGUID{Value: "b"}, PubDate: "Tue, 01 Apr 2025 01:00:00 -0400"},
+	}
+	merged, err := s.Merge("show", nil, old)
+	if err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	if len(merged) != 2 {
+		t.Fatalf("len(merged) = %d, want 2", len(merged))
+	}
 
-	want := []edit{
-		{off: 618, end: 632, text: name},
-		{off: 1977, end: 1991, text: name},
+	stored, err := s.Load("show")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
 	}
 
-	got := fixShowTitle([]byte(prelude), name)
-	if !slices.Equal(got, want) {
-		t.Errorf("show title not replaced:\ngot:  %+v\nwant: %+v", got, want)
+	// upstream no longer serves "b" but adds a brand new item "c";
+	// with maxItems 2 the merge keeps the two newest, "c" and "a",
+	// and caps out the oldest, "b".
+	fresh := []rssItem{
+		{GUID: &rssGUID{Value: "a"}, PubDate: "Wed, 02 Apr 2025 01:00:00 -0400"},
+		{GUID: &rssGUID{Value: "c"}, PubDate: "Thu, 03 Apr 2025 01:00:00 -0400"},
+	}
+	merged, err = s.Merge("show", stored, fresh)
+	if err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+
+	if len(merged) != 2 {
+		t.Fatalf("len(merged) = %d, want 2", len(merged))
+	}
+	if merged[0].Key != "c" || merged[1].Key != "a" {
+		t.Errorf("merged = %+v, want [c, a] (newest first, capped)", merged)
+	}
+}
+
+func TestFeedClientFetch(t *testing.T) {
+	const body = "<rss></rss>"
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("User-Agent") != userAgent {
+			t.Errorf("User-Agent = %q, want %q", r.Header.Get("User-Agent"), userAgent)
+		}
+		if r.Header.Get("If-None-Match") == `"etag"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	c := newFeedClient()
+	result, err := c.Fetch(context.Background(), srv.URL, fetchResult{})
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if string(result.Body) != body {
+		t.Errorf("Body = %q, want %q", result.Body, body)
+	}
+
+	if _, err := c.Fetch(context.Background(), srv.URL, result); !errors.Is(err, errNotModified) {
+		t.Errorf("Fetch (conditional) err = %v, want errNotModified", err)
+	}
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+}
+
+func TestFeedClientGzip(t *testing.T) {
+	const body = "<rss></rss>"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(body))
+		gz.Close()
+	}))
+	defer srv.Close()
+
+	c := newFeedClient()
+	result, err := c.Fetch(context.Background(), srv.URL, fetchResult{})
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if string(result.Body) != body {
+		t.Errorf("Body = %q, want %q", result.Body, body)
+	}
+}
+
+func TestFeedClientStatusError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	c := newFeedClient()
+	_, err := c.Fetch(context.Background(), srv.URL, fetchResult{})
+	var statusErr *httpStatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("Fetch err = %v, want *httpStatusError", err)
+	}
+}
+
+func TestRenderOPML(t *testing.T) {
+	data, err := renderOPML([]opmlFeed{
+		{Show: "Bad Friends", SysName: "bad-friends"},
+		{Show: "Y-Chromes", SysName: "y-chromes"},
+	}, "https://example.com")
+	if err != nil {
+		t.Fatalf("renderOPML: %v", err)
+	}
+
+	var doc opmlDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("xml.Unmarshal: %v", err)
+	}
+
+	want := []opmlOutline{
+		{Text: "Bad Friends", Type: "rss", XMLURL: "https://example.com/bad-friends.xml"},
+		{Text: "Y-Chromes", Type: "rss", XMLURL: "https://example.com/y-chromes.xml"},
+	}
+	if !slices.Equal(doc.Body.Outlines, want) {
+		t.Errorf("outlines = %+v, want %+v", doc.Body.Outlines, want)
+	}
+}
+
+func TestPublicBaseURL(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/opml", nil)
+	req.Host = "badlands.example.com"
+
+	if got := publicBaseURL(req, "https://public.example.com/"); got != "https://public.example.com" {
+		t.Errorf("publicBaseURL(configured) = %q, want %q", got, "https://public.example.com")
+	}
+
+	if got := publicBaseURL(req, ""); got != "http://badlands.example.com" {
+		t.Errorf("publicBaseURL(derived) = %q, want %q", got, "http://badlands.example.com")
+	}
+
+	req.Header.Set("X-Forwarded-Proto", "https")
+	if got := publicBaseURL(req, ""); got != "https://badlands.example.com" {
+		t.Errorf("publicBaseURL(forwarded proto) = %q, want %q", got, "https://badlands.example.com")
+	}
+}
+
+func TestNotifierDeliver(t *testing.T) {
+	received := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+	}))
+	defer srv.Close()
+
+	n := newNotifier(srv.URL, notifyFormatJSON, slog.Default())
+	en := episodeNotification{Show: "Bad Friends", SysName: "bad-friends", Title: "Pilot", GUID: "bad-friends-1"}
+	n.Notify(en)
+
+	select {
+	case body := <-received:
+		var got episodeNotification
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatalf("json.Unmarshal: %v", err)
+		}
+		if got.Show != en.Show || got.SysName != en.SysName || got.Title != en.Title || got.GUID != en.GUID {
+			t.Errorf("delivered = %+v, want %+v", got, en)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for webhook delivery")
+	}
+}
+
+func TestNotifierAppriseFormat(t *testing.T) {
+	n := &notifier{format: notifyFormatApprise}
+	data, err := n.encode(episodeNotification{Show: "Bad Friends", Title: "Pilot"})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	var got appriseNotification
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if got.Body != "Pilot" || got.Type != "info" {
+		t.Errorf("encode(apprise) = %+v, want body %q", got, "Pilot")
+	}
+}
+
+func TestFeedsNotifyNewItems(t *testing.T) {
+	received := make(chan episodeNotification, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var en episodeNotification
+		json.NewDecoder(r.Body).Decode(&en)
+		received <- en
+	}))
+	defer srv.Close()
+
+	f := &feeds{
+		notifiedKeys: make(map[string]map[string]bool),
+		notifier:     newNotifier(srv.URL, notifyFormatJSON, slog.Default()),
+	}
+
+	pilot := rssItem{Title: "Pilot", GUID: &rssGUID{Value: "bad-friends-1"}}
+	followup := rssItem{Title: "Episode 2", GUID: &rssGUID{Value: "bad-friends-2"}}
+
+	// The first pass for a sysName (the first fetch after every
+	// process start, with or without -state-dir) must only seed
+	// known keys, not notify.
+	f.notifyNewItems("Bad Friends", "bad-friends", "http://example.test/feed", []rssItem{pilot})
+	select {
+	case en := <-received:
+		t.Fatalf("unexpected notification on first pass: %+v", en)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// A later pass with the same item plus one new one must notify
+	// only on the new item, even though the first item is still
+	// present every time (e.g. no -state-dir to remember it by).
+	f.notifyNewItems("Bad Friends", "bad-friends", "http://example.test/feed", []rssItem{pilot, followup})
+	select {
+	case en := <-received:
+		if en.GUID != "bad-friends-2" {
+			t.Errorf("notified guid = %q, want %q", en.GUID, "bad-friends-2")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for webhook delivery")
+	}
+
+	select {
+	case en := <-received:
+		t.Fatalf("unexpected extra notification: %+v", en)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestLoadConfigDefault(t *testing.T) {
+	cfg, err := loadConfig("")
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if len(cfg.Feeds) != 1 || cfg.Feeds[0].Source != defaultFeedURL {
+		t.Errorf("loadConfig(\"\") = %+v, want single feed with source %q", cfg.Feeds, defaultFeedURL)
 	}
 }